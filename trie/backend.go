@@ -0,0 +1,150 @@
+package trie
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Backend stores and retrieves serialized nodes by content hash, so a
+// Trie can live partly (or entirely) outside process memory. Get
+// returns an error for a hash the backend doesn't hold; callers treat
+// that as a node miss rather than a hard failure where it's safe to
+// retry after fetching the blob out-of-band.
+type Backend interface {
+	Get(hash []byte) ([]byte, error)
+	Put(hash, blob []byte) error
+	Delete(hash []byte) error
+}
+
+// Cache wraps a Backend with an in-memory write-through layer: Put
+// writes to the backend and then to a map, and Get reads the map
+// before touching the backend (storing what it fetches), so a node
+// fetched or written once doesn't cost a second round trip.
+type Cache struct {
+	mu      sync.RWMutex
+	backend Backend
+	mem     map[string][]byte
+}
+
+// NewCache returns a Cache fronting backend.
+func NewCache(backend Backend) *Cache {
+	return &Cache{backend: backend, mem: make(map[string][]byte)}
+}
+
+func (c *Cache) Get(hash []byte) ([]byte, error) {
+	key := string(hash)
+	c.mu.RLock()
+	blob, ok := c.mem[key]
+	c.mu.RUnlock()
+	if ok {
+		return blob, nil
+	}
+
+	blob, err := c.backend.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.mem[key] = blob
+	c.mu.Unlock()
+	return blob, nil
+}
+
+func (c *Cache) Put(hash, blob []byte) error {
+	if err := c.backend.Put(hash, blob); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.mem[string(hash)] = blob
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Cache) Delete(hash []byte) error {
+	if err := c.backend.Delete(hash); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.mem, string(hash))
+	c.mu.Unlock()
+	return nil
+}
+
+// MissingNodeError is returned when a Trie backed by a Backend needs a
+// node that the backend can't supply. Hash and Path identify which
+// node, so a caller can fetch the blob from wherever it actually lives
+// (a remote peer, cold storage, ...) and retry.
+type MissingNodeError struct {
+	Hash []byte
+	Path []byte
+}
+
+func (e *MissingNodeError) Error() string {
+	return fmt.Sprintf("trie: missing node %x at path %q", e.Hash, e.Path)
+}
+
+// ValueCodec encodes and decodes the values stored at terminal nodes,
+// so Commit can serialize them alongside the tree shape. NewTrie's
+// default in-memory Trie never needs one; it's only consulted by a
+// Trie created with NewTrieWithBackend.
+type ValueCodec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// JSONValueCodec encodes values with encoding/json. It's the default
+// codec for a Trie created with NewTrieWithBackend; swap it out with
+// SetValueCodec for values JSON can't round-trip faithfully.
+type JSONValueCodec struct{}
+
+func (JSONValueCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONValueCodec) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// MemoryBackend is a Backend that keeps every blob in a map. It's
+// meant for tests and benchmarks that want to exercise the lazy-load
+// path without standing up real storage: drop a Trie's Cache in front
+// of it and it behaves like any other Backend, just backed by RAM
+// instead of disk.
+type MemoryBackend struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{data: make(map[string][]byte)}
+}
+
+func (b *MemoryBackend) Get(hash []byte) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	blob, ok := b.data[string(hash)]
+	if !ok {
+		return nil, fmt.Errorf("trie: memory backend has no blob for hash %x", hash)
+	}
+	return blob, nil
+}
+
+func (b *MemoryBackend) Put(hash, blob []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data[string(hash)] = append([]byte(nil), blob...)
+	return nil
+}
+
+func (b *MemoryBackend) Delete(hash []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.data, string(hash))
+	return nil
+}
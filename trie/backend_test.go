@@ -0,0 +1,317 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCommitAndReopen(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree := NewTrie()
+	insert(t, tree, []string{"apple", "application", "banana"})
+
+	tree2, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	for _, key := range []string{"apple", "application", "banana"} {
+		n, _ := tree.Find([]byte(key))
+		tree2.ReplaceOrInsert([]byte(key), n.Value())
+	}
+
+	rootHash, err := tree2.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if len(rootHash) == 0 {
+		t.Fatal("Commit returned an empty hash")
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+	if reopened.Size() != 3 {
+		t.Fatalf("Size() after reopen = %d, want 3", reopened.Size())
+	}
+
+	n, ok := reopened.Find([]byte("application"))
+	if !ok {
+		t.Fatal("Find(\"application\") after reopen = false, want true")
+	}
+	if n.Value() != "application" {
+		t.Fatalf("Find(\"application\").Value() = %v, want %q", n.Value(), "application")
+	}
+	if _, ok := reopened.Find([]byte("missing")); ok {
+		t.Fatal("Find(\"missing\") after reopen = true, want false")
+	}
+
+	var got []string
+	reopened.PrefixSearch([]byte("app"), func(key []byte, val interface{}) bool {
+		got = append(got, string(key))
+		return true
+	})
+	want := []string{"apple", "application"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("PrefixSearch(%q) after reopen = %v, want %v", "app", got, want)
+	}
+}
+
+func TestReopenedTrieDoesNotEagerlyLoadEveryNode(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	tree.ReplaceOrInsert([]byte("alpha"), "alpha")
+	tree.ReplaceOrInsert([]byte("beta"), "beta")
+	rootHash, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+	if n, ok := reopened.root.children.get('a'); !ok || n.resolved {
+		t.Fatal("reopened root's children should be unresolved stubs until visited")
+	}
+
+	n, ok := reopened.Find([]byte("alpha"))
+	if !ok || n.Value() != "alpha" {
+		t.Fatalf("Find(\"alpha\") = (%v, %v), want (\"alpha\", true)", n, ok)
+	}
+}
+
+func TestFindReportsMissingNode(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	tree.ReplaceOrInsert([]byte("gone"), "gone")
+	rootHash, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	child, _ := tree.root.children.get('g')
+	if err := backend.Delete(child.hash); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+	if _, ok := reopened.Find([]byte("gone")); ok {
+		t.Fatal("Find(\"gone\") = true, want false after its blob was deleted")
+	}
+	missing, ok := reopened.LastErr().(*MissingNodeError)
+	if !ok {
+		t.Fatalf("LastErr() = %v, want a *MissingNodeError", reopened.LastErr())
+	}
+	if string(missing.Path) != "gone" {
+		t.Fatalf("MissingNodeError.Path = %q, want %q", missing.Path, "gone")
+	}
+}
+
+func TestReplaceOrInsertAfterReopenUpdatesInPlace(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	tree.ReplaceOrInsert([]byte("gopher"), "v1")
+	rootHash, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+
+	// Updating an already-stored key, without a prior Find to warm the
+	// path, must not be treated as a brand-new insert.
+	old := reopened.ReplaceOrInsert([]byte("gopher"), "v2")
+	if old == nil || old.Value() != "v1" {
+		t.Fatalf("ReplaceOrInsert returned %v, want the old value %q", old, "v1")
+	}
+	if reopened.Size() != 1 {
+		t.Fatalf("Size() after update = %d, want 1", reopened.Size())
+	}
+
+	n, ok := reopened.Find([]byte("gopher"))
+	if !ok || n.Value() != "v2" {
+		t.Fatalf("Find(\"gopher\") = (%v, %v), want (\"v2\", true)", n, ok)
+	}
+
+	// A Commit right after the update must persist the new value, not
+	// re-fetch and clobber it with the stale blob.
+	rootHash2, err := reopened.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	again, err := NewTrieWithBackend(backend, rootHash2)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen again): %v", err)
+	}
+	n, ok = again.Find([]byte("gopher"))
+	if !ok || n.Value() != "v2" {
+		t.Fatalf("Find(\"gopher\") after re-commit = (%v, %v), want (\"v2\", true)", n, ok)
+	}
+	if again.Size() != 1 {
+		t.Fatalf("Size() after re-commit = %d, want 1", again.Size())
+	}
+}
+
+func TestNodeIteratorOnReopenedTrie(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	keys := []string{"alpha", "beta", "gamma"}
+	for _, k := range keys {
+		tree.ReplaceOrInsert([]byte(k), k)
+	}
+	rootHash, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+
+	var got []string
+	it := reopened.NodeIterator(nil)
+	for it.Next() {
+		if it.Leaf() {
+			got = append(got, string(it.LeafKey()))
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("NodeIterator.Err() = %v, want nil", err)
+	}
+	want := []string{"alpha", "beta", "gamma"}
+	if len(got) != len(want) {
+		t.Fatalf("NodeIterator walked %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("NodeIterator walked %v, want %v", got, want)
+		}
+	}
+
+	if got := reopened.NextKey([]byte("alpha")); string(got) != "beta" {
+		t.Fatalf("NextKey(%q) = %q, want %q", "alpha", got, "beta")
+	}
+}
+
+func TestClearPrefixOnReopenedTrie(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	for _, k := range []string{"ab", "abc", "abd", "ac"} {
+		tree.ReplaceOrInsert([]byte(k), k)
+	}
+	rootHash, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+
+	n := reopened.ClearPrefix([]byte("ab"))
+	if n != 3 {
+		t.Fatalf("ClearPrefix(%q) removed %d keys, want 3", "ab", n)
+	}
+	if _, ok := reopened.Find([]byte("ac")); !ok {
+		t.Fatal("ClearPrefix removed an unrelated key")
+	}
+}
+
+func TestGetOnReopenedTrie(t *testing.T) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	for _, k := range []string{"c3f279d17e0a", "a4d8f3"} {
+		tree.ReplaceOrInsert([]byte(k), k)
+	}
+	rootHash, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		t.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+
+	n, err := reopened.Get([]byte("a4"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(n.Key()) != "a4d8f3" {
+		t.Fatalf("Get(%q).Key() = %q, want %q", "a4", n.Key(), "a4d8f3")
+	}
+}
+
+func TestCacheIsWriteThrough(t *testing.T) {
+	backend := NewMemoryBackend()
+	cache := NewCache(backend)
+
+	if err := cache.Put([]byte("h1"), []byte("blob")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := backend.Delete([]byte("h1")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	blob, err := cache.Get([]byte("h1"))
+	if err != nil {
+		t.Fatalf("Get after backend delete: %v", err)
+	}
+	if string(blob) != "blob" {
+		t.Fatalf("Get returned %q, want %q", blob, "blob")
+	}
+}
+
+func BenchmarkFindOnLargeBackendTrie(b *testing.B) {
+	backend := NewMemoryBackend()
+	tree, err := NewTrieWithBackend(backend, nil)
+	if err != nil {
+		b.Fatalf("NewTrieWithBackend: %v", err)
+	}
+	keys := make([]string, 5000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		tree.ReplaceOrInsert([]byte(keys[i]), keys[i])
+	}
+	rootHash, err := tree.Commit()
+	if err != nil {
+		b.Fatalf("Commit: %v", err)
+	}
+
+	reopened, err := NewTrieWithBackend(backend, rootHash)
+	if err != nil {
+		b.Fatalf("NewTrieWithBackend(reopen): %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reopened.Find([]byte(keys[i%len(keys)]))
+	}
+}
@@ -0,0 +1,152 @@
+package trie
+
+import "sort"
+
+// sparseMaxChildren is the largest number of children a sparseChildList
+// will hold before it upgrades to a denseChildList, and the largest
+// number a denseChildList will shrink back down to before it downgrades
+// to sparse again.
+const sparseMaxChildren = 8
+
+// childList stores a Node's children keyed by the first rune of each
+// child's edge label. Most nodes only ever branch a handful of ways, so
+// the default sparseChildList keeps them in a small sorted slice with
+// no map overhead; a node whose fan-out grows past sparseMaxChildren
+// (typically the root of a large key set) upgrades to a denseChildList
+// backed by a map for O(1) lookups. set/remove return the (possibly
+// different) childList to store back on the Node, since an upgrade or
+// downgrade swaps the underlying implementation.
+type childList interface {
+	get(r rune) (*Node, bool)
+	set(r rune, n *Node) childList
+	remove(r rune) childList
+	len() int
+	// each calls fn for every child in ascending rune order, stopping
+	// early if fn returns false.
+	each(fn func(r rune, n *Node) bool)
+}
+
+// newChildList returns the empty childList a freshly created Node
+// starts out with.
+func newChildList() childList {
+	return sparseChildList(nil)
+}
+
+type childEntry struct {
+	r rune
+	n *Node
+}
+
+// sparseChildList is a childList kept as a slice sorted by rune, which
+// keeps traversal order free (no per-call sort) and avoids the map
+// allocation for the common case of a few children per node.
+type sparseChildList []childEntry
+
+func (s sparseChildList) search(r rune) int {
+	return sort.Search(len(s), func(i int) bool { return s[i].r >= r })
+}
+
+func (s sparseChildList) get(r rune) (*Node, bool) {
+	i := s.search(r)
+	if i < len(s) && s[i].r == r {
+		return s[i].n, true
+	}
+	return nil, false
+}
+
+func (s sparseChildList) set(r rune, n *Node) childList {
+	i := s.search(r)
+	if i < len(s) && s[i].r == r {
+		s[i].n = n
+		return s
+	}
+	s = append(s, childEntry{})
+	copy(s[i+1:], s[i:])
+	s[i] = childEntry{r: r, n: n}
+	if len(s) > sparseMaxChildren {
+		return s.toDense()
+	}
+	return s
+}
+
+func (s sparseChildList) remove(r rune) childList {
+	i := s.search(r)
+	if i >= len(s) || s[i].r != r {
+		return s
+	}
+	return append(s[:i], s[i+1:]...)
+}
+
+func (s sparseChildList) len() int {
+	return len(s)
+}
+
+func (s sparseChildList) each(fn func(r rune, n *Node) bool) {
+	for _, e := range s {
+		if !fn(e.r, e.n) {
+			return
+		}
+	}
+}
+
+func (s sparseChildList) toDense() childList {
+	d := make(denseChildList, len(s))
+	for _, e := range s {
+		d[e.r] = e.n
+	}
+	return d
+}
+
+// denseChildList is a childList backed by a map, for nodes whose
+// fan-out has grown past sparseMaxChildren.
+type denseChildList map[rune]*Node
+
+func (d denseChildList) get(r rune) (*Node, bool) {
+	n, ok := d[r]
+	return n, ok
+}
+
+func (d denseChildList) set(r rune, n *Node) childList {
+	d[r] = n
+	return d
+}
+
+func (d denseChildList) remove(r rune) childList {
+	delete(d, r)
+	if len(d) <= sparseMaxChildren {
+		return d.toSparse()
+	}
+	return d
+}
+
+func (d denseChildList) len() int {
+	return len(d)
+}
+
+func (d denseChildList) each(fn func(r rune, n *Node) bool) {
+	codes := make([]rune, 0, len(d))
+	for r := range d {
+		codes = append(codes, r)
+	}
+	sort.Sort(ByRune(codes))
+	for _, r := range codes {
+		if !fn(r, d[r]) {
+			return
+		}
+	}
+}
+
+func (d denseChildList) toSparse() childList {
+	s := make(sparseChildList, 0, len(d))
+	for r, n := range d {
+		s = append(s, childEntry{r: r, n: n})
+	}
+	sort.Sort(sparseByRune(s))
+	return s
+}
+
+type sparseByRune sparseChildList
+
+func (s sparseByRune) Len() int           { return len(s) }
+func (s sparseByRune) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sparseByRune) Less(i, j int) bool { return s[i].r < s[j].r }
@@ -0,0 +1,133 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChildListUpgradeToDense(t *testing.T) {
+	var l childList = newChildList()
+	for i := 0; i < sparseMaxChildren; i++ {
+		l = l.set(rune('a'+i), &Node{})
+	}
+	if _, ok := l.(sparseChildList); !ok {
+		t.Fatalf("expected sparseChildList at %d children, got %T", sparseMaxChildren, l)
+	}
+
+	l = l.set('z', &Node{})
+	if _, ok := l.(denseChildList); !ok {
+		t.Fatalf("expected upgrade to denseChildList past %d children, got %T", sparseMaxChildren, l)
+	}
+	if l.len() != sparseMaxChildren+1 {
+		t.Fatalf("expected %d children, got %d", sparseMaxChildren+1, l.len())
+	}
+}
+
+func TestChildListDowngradeToSparse(t *testing.T) {
+	var l childList = newChildList()
+	for i := 0; i <= sparseMaxChildren+2; i++ {
+		l = l.set(rune('a'+i), &Node{})
+	}
+	if _, ok := l.(denseChildList); !ok {
+		t.Fatalf("expected denseChildList, got %T", l)
+	}
+
+	l = l.remove('a')
+	l = l.remove('b')
+	l = l.remove('c')
+	if _, ok := l.(sparseChildList); !ok {
+		t.Fatalf("expected downgrade to sparseChildList, got %T", l)
+	}
+}
+
+func TestChildListGetSetRemove(t *testing.T) {
+	for _, start := range []childList{newChildList(), make(denseChildList)} {
+		l := start
+		nodes := make(map[rune]*Node)
+		for i := 0; i < sparseMaxChildren*2; i++ {
+			r := rune('a' + i)
+			n := &Node{}
+			nodes[r] = n
+			l = l.set(r, n)
+		}
+		for r, n := range nodes {
+			got, ok := l.get(r)
+			if !ok || got != n {
+				t.Fatalf("get(%q) = %v, %v; want %v, true", r, got, ok, n)
+			}
+		}
+		if _, ok := l.get('!'); ok {
+			t.Fatal("get on an absent rune should report false")
+		}
+
+		l = l.remove('a')
+		if _, ok := l.get('a'); ok {
+			t.Fatal("removed child should no longer be found")
+		}
+		if l.len() != sparseMaxChildren*2-1 {
+			t.Fatalf("expected %d children after remove, got %d", sparseMaxChildren*2-1, l.len())
+		}
+	}
+}
+
+func TestChildListEachIsSorted(t *testing.T) {
+	for _, start := range []childList{newChildList(), make(denseChildList)} {
+		l := start
+		runes := []rune{'d', 'b', 'a', 'c', 'e', 'f', 'z', 'y', 'x'}
+		for _, r := range runes {
+			l = l.set(r, &Node{})
+		}
+		var seen []rune
+		l.each(func(r rune, n *Node) bool {
+			seen = append(seen, r)
+			return true
+		})
+		for i := 1; i < len(seen); i++ {
+			if seen[i-1] >= seen[i] {
+				t.Fatalf("each did not yield runes in ascending order: %v", seen)
+			}
+		}
+	}
+}
+
+func BenchmarkSparseChildListSet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var l childList = newChildList()
+		for r := 0; r < sparseMaxChildren; r++ {
+			l = l.set(rune('a'+r), &Node{})
+		}
+	}
+}
+
+func BenchmarkDenseChildListSet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var l childList = newChildList()
+		for r := 0; r < sparseMaxChildren*8; r++ {
+			l = l.set(rune(r), &Node{})
+		}
+	}
+}
+
+func BenchmarkPreTraverseFewChildren(b *testing.B) {
+	tree := NewTrie()
+	for i := 0; i < sparseMaxChildren; i++ {
+		tree.ReplaceOrInsert([]byte(fmt.Sprintf("key-%d", i)), i)
+	}
+	iter := func(key []byte, val interface{}) bool { return true }
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.PrefixSearch(nil, iter)
+	}
+}
+
+func BenchmarkPreTraverseManyChildren(b *testing.B) {
+	tree := NewTrie()
+	for i := 0; i < sparseMaxChildren*32; i++ {
+		tree.ReplaceOrInsert([]byte(fmt.Sprintf("key-%d", i)), i)
+	}
+	iter := func(key []byte, val interface{}) bool { return true }
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.PrefixSearch(nil, iter)
+	}
+}
@@ -0,0 +1,309 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidUTF8 is reported by a NodeIterator that walks into an
+	// edge label containing an invalid rune.
+	ErrInvalidUTF8 = errors.New("trie: invalid utf8 along iterator path")
+	// ErrConcurrentModification is reported by a NodeIterator whose
+	// underlying Trie was mutated (ReplaceOrInsert, Delete, ...) after
+	// the iterator was created.
+	ErrConcurrentModification = errors.New("trie: trie was modified during iteration")
+)
+
+// iterFrame is a pending stack entry: a node still to be visited, and
+// the full rune path from the trie's root down to it.
+type iterFrame struct {
+	node *Node
+	path []rune
+}
+
+// NodeIterator is a resumable, stateful cursor over every node of a
+// Trie (branch nodes as well as terminal leaves) in the same preorder,
+// lexicographic sequence PrefixSearch's callback visits. Call Next to
+// advance; it returns false once the walk is exhausted or Err reports
+// a problem.
+type NodeIterator struct {
+	trie   *Trie
+	modSeq int
+	stack  []iterFrame
+	cur    *iterFrame
+	err    error
+}
+
+// NodeIterator returns a NodeIterator positioned before the first key
+// greater than or equal to start (or before the very first key, if
+// start is empty). Call Next to advance onto it.
+//
+// For a Trie opened with NewTrieWithBackend, the returned iterator
+// lazily materializes every node it walks through; a backend miss is
+// reported through Err.
+func (t *Trie) NodeIterator(start []byte) *NodeIterator {
+	it := &NodeIterator{trie: t, modSeq: t.modSeq}
+	if len(start) > 0 && !utf8.Valid(start) {
+		it.err = ErrInvalidUTF8
+		return it
+	}
+	stack, err := t.seek(parseTextToRunes(start))
+	if err != nil {
+		it.err = err
+		return it
+	}
+	it.stack = stack
+	return it
+}
+
+// seek returns the stack of pending nodes (ordered so the smallest
+// unvisited one pops last-in-first-out) needed to resume a preorder
+// walk at the first key greater than or equal to start.
+func (t *Trie) seek(start []rune) ([]iterFrame, error) {
+	var stack []iterFrame
+	node := t.root
+	if err := t.materialize(node); err != nil {
+		return nil, err
+	}
+	path := []rune{}
+	rest := start
+
+	for {
+		if len(rest) == 0 {
+			return append(stack, iterFrame{node: node, path: append([]rune(nil), path...)}), nil
+		}
+
+		var children []*Node
+		node.children.each(func(r rune, c *Node) bool {
+			children = append(children, c)
+			return true
+		})
+
+		// children is sorted ascending by first rune. Children whose
+		// first rune is below rest[0] sort entirely before start and
+		// are dropped; children whose first rune is above rest[0] sort
+		// entirely after start and are queued whole.
+		matchIdx := -1
+		for i, c := range children {
+			if c.label[0] < rest[0] {
+				continue
+			}
+			if c.label[0] == rest[0] {
+				matchIdx = i
+				continue
+			}
+			for j := len(children) - 1; j >= i; j-- {
+				g := children[j]
+				stack = append(stack, iterFrame{node: g, path: appendRunes(path, g.label)})
+			}
+			break
+		}
+
+		if matchIdx == -1 {
+			return stack, nil
+		}
+
+		child := children[matchIdx]
+		cpl := commonPrefixLen(rest, child.label)
+		switch {
+		case cpl == len(child.label) && cpl == len(rest):
+			return append(stack, iterFrame{node: child, path: appendRunes(path, child.label)}), nil
+		case cpl == len(child.label):
+			node = child
+			if err := t.materialize(node); err != nil {
+				return nil, err
+			}
+			path = appendRunes(path, child.label)
+			rest = rest[cpl:]
+		case cpl == len(rest):
+			// rest is a strict prefix of child's label, so every key
+			// under child (including child's own, if terminal) sorts
+			// at or after start.
+			return append(stack, iterFrame{node: child, path: appendRunes(path, child.label)}), nil
+		default:
+			if rest[cpl] < child.label[cpl] {
+				stack = append(stack, iterFrame{node: child, path: appendRunes(path, child.label)})
+			}
+			return stack, nil
+		}
+	}
+}
+
+func appendRunes(a, b []rune) []rune {
+	out := make([]rune, 0, len(a)+len(b))
+	out = append(out, a...)
+	out = append(out, b...)
+	return out
+}
+
+// Next advances the iterator to the next node and reports whether one
+// was available. Once it returns false, Err reports whether that was
+// a clean end of traversal or a genuine error.
+func (it *NodeIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.trie.modSeq != it.modSeq {
+		it.err = ErrConcurrentModification
+		it.cur = nil
+		return false
+	}
+	if len(it.stack) == 0 {
+		it.cur = nil
+		return false
+	}
+
+	top := it.stack[len(it.stack)-1]
+	it.stack = it.stack[:len(it.stack)-1]
+	it.cur = &top
+
+	if err := it.trie.materialize(top.node); err != nil {
+		// The current frame is still a valid position; the error
+		// surfaces on the next call instead of this one.
+		it.err = err
+		return true
+	}
+
+	var children []*Node
+	top.node.children.each(func(r rune, c *Node) bool {
+		children = append(children, c)
+		return true
+	})
+	for i := len(children) - 1; i >= 0; i-- {
+		c := children[i]
+		for _, r := range c.label {
+			if !utf8.ValidRune(r) {
+				// The current frame is still a valid position; the
+				// error surfaces on the next call instead of this one.
+				it.err = ErrInvalidUTF8
+				return true
+			}
+		}
+		it.stack = append(it.stack, iterFrame{node: c, path: appendRunes(top.path, c.label)})
+	}
+	return true
+}
+
+// Leaf reports whether the iterator's current position stores a key.
+func (it *NodeIterator) Leaf() bool {
+	return it.cur != nil && it.cur.node.term
+}
+
+// LeafKey returns the full key at the current position, or nil if the
+// current position is not a leaf.
+func (it *NodeIterator) LeafKey() []byte {
+	if !it.Leaf() {
+		return nil
+	}
+	return parseRunesToText(it.cur.path)
+}
+
+// Value returns the value stored at the current position, or nil if
+// the iterator hasn't been advanced onto a node yet.
+func (it *NodeIterator) Value() interface{} {
+	if it.cur == nil {
+		return nil
+	}
+	return it.cur.node.Value()
+}
+
+// Path returns the rune path from the trie's root to the current
+// position.
+func (it *NodeIterator) Path() []rune {
+	if it.cur == nil {
+		return nil
+	}
+	return append([]rune(nil), it.cur.path...)
+}
+
+// Err reports the first error encountered during iteration, if any.
+func (it *NodeIterator) Err() error {
+	return it.err
+}
+
+// DifferenceIterator walks b in lexicographic order, yielding the
+// leaves it holds that a does not. Both iterators must come from
+// NodeIterator, which already walks in lexicographic order.
+type DifferenceIterator struct {
+	a, b     *NodeIterator
+	aStarted bool
+	aDone    bool
+	aKey     []byte
+
+	key   []byte
+	value interface{}
+	path  []rune
+	err   error
+}
+
+// NewDifferenceIterator returns an iterator over the keys present in
+// b's trie but not in a's.
+func NewDifferenceIterator(a, b *NodeIterator) *DifferenceIterator {
+	return &DifferenceIterator{a: a, b: b}
+}
+
+func (d *DifferenceIterator) advanceA() {
+	for {
+		if !d.a.Next() {
+			d.aDone = true
+			d.aKey = nil
+			if err := d.a.Err(); err != nil {
+				d.err = err
+			}
+			return
+		}
+		if d.a.Leaf() {
+			d.aKey = d.a.LeafKey()
+			return
+		}
+	}
+}
+
+// Next advances to the next key found in b but not in a.
+func (d *DifferenceIterator) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	if !d.aStarted {
+		d.aStarted = true
+		d.advanceA()
+		if d.err != nil {
+			return false
+		}
+	}
+
+	for {
+		if !d.b.Next() {
+			if err := d.b.Err(); err != nil {
+				d.err = err
+			}
+			d.key, d.value, d.path = nil, nil, nil
+			return false
+		}
+		if !d.b.Leaf() {
+			continue
+		}
+
+		bKey := d.b.LeafKey()
+		for !d.aDone && bytes.Compare(d.aKey, bKey) < 0 {
+			d.advanceA()
+			if d.err != nil {
+				return false
+			}
+		}
+		if d.aDone || !bytes.Equal(d.aKey, bKey) {
+			d.key = bKey
+			d.value = d.b.Value()
+			d.path = d.b.Path()
+			return true
+		}
+	}
+}
+
+func (d *DifferenceIterator) Leaf() bool         { return d.key != nil }
+func (d *DifferenceIterator) LeafKey() []byte    { return d.key }
+func (d *DifferenceIterator) Value() interface{} { return d.value }
+func (d *DifferenceIterator) Path() []rune       { return d.path }
+func (d *DifferenceIterator) Err() error         { return d.err }
@@ -0,0 +1,163 @@
+package trie
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNodeIteratorExhausts(t *testing.T) {
+	tree := NewTrie()
+	keys := []string{"a", "ab", "abc", "abd", "b", "bc"}
+	insert(t, tree, keys)
+
+	var got []string
+	it := tree.NodeIterator(nil)
+	for it.Next() {
+		if it.Leaf() {
+			got = append(got, string(it.LeafKey()))
+		}
+	}
+	if it.Err() != nil {
+		t.Fatalf("unexpected error: %v", it.Err())
+	}
+	if !reflect.DeepEqual(got, keys) {
+		t.Fatalf("iterator produced %v, want %v", got, keys)
+	}
+
+	// the iterator stays exhausted: further Next calls keep returning false.
+	if it.Next() {
+		t.Fatal("expected iterator to stay exhausted")
+	}
+}
+
+func TestNodeIteratorSeeksMidSubtree(t *testing.T) {
+	tree := NewTrie()
+	keys := []string{"a", "ab", "abc", "abd", "ac", "b", "bc", "bd"}
+	insert(t, tree, keys)
+
+	var got []string
+	it := tree.NodeIterator([]byte("abd"))
+	for it.Next() {
+		if it.Leaf() {
+			got = append(got, string(it.LeafKey()))
+		}
+	}
+	if it.Err() != nil {
+		t.Fatalf("unexpected error: %v", it.Err())
+	}
+	want := []string{"abd", "ac", "b", "bc", "bd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("seek from %q produced %v, want %v", "abd", got, want)
+	}
+
+	// seeking to a key that isn't stored should land on the next one after it.
+	got = nil
+	it = tree.NodeIterator([]byte("abca"))
+	for it.Next() {
+		if it.Leaf() {
+			got = append(got, string(it.LeafKey()))
+		}
+	}
+	want = []string{"abd", "ac", "b", "bc", "bd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("seek from %q produced %v, want %v", "abca", got, want)
+	}
+
+	// seeking past the end yields nothing.
+	got = nil
+	it = tree.NodeIterator([]byte("z"))
+	for it.Next() {
+		if it.Leaf() {
+			got = append(got, string(it.LeafKey()))
+		}
+	}
+	if len(got) != 0 {
+		t.Fatalf("seek past the end produced %v, want none", got)
+	}
+}
+
+func TestNodeIteratorInvalidUTF8Start(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"a"})
+
+	it := tree.NodeIterator([]byte{0xff, 0xfe})
+	if it.Next() {
+		t.Fatal("expected Next to fail on an invalid utf8 start key")
+	}
+	if it.Err() != ErrInvalidUTF8 {
+		t.Fatalf("expected ErrInvalidUTF8, got %v", it.Err())
+	}
+}
+
+func TestNodeIteratorCorruptedPath(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"a", "ab"})
+
+	// poke an invalid rune into a live edge label to simulate corruption
+	// reached mid-walk.
+	root := tree.Root()
+	var aNode *Node
+	root.ForEachChild(func(r rune, c *Node) bool {
+		aNode = c
+		return false
+	})
+	aNode.label[0] = -1
+
+	it := tree.NodeIterator(nil)
+	sawErr := false
+	for it.Next() {
+		if it.Err() != nil {
+			sawErr = true
+			break
+		}
+	}
+	if !sawErr && it.Err() == nil {
+		t.Fatal("expected the iterator to report ErrInvalidUTF8 after the corrupted edge")
+	}
+	if it.Err() != ErrInvalidUTF8 {
+		t.Fatalf("expected ErrInvalidUTF8, got %v", it.Err())
+	}
+}
+
+func TestNodeIteratorConcurrentModification(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"a", "ab", "b"})
+
+	it := tree.NodeIterator(nil)
+	it.Next()
+	tree.ReplaceOrInsert([]byte("c"), "c")
+
+	if it.Next() {
+		t.Fatal("expected Next to fail after a concurrent modification")
+	}
+	if it.Err() != ErrConcurrentModification {
+		t.Fatalf("expected ErrConcurrentModification, got %v", it.Err())
+	}
+}
+
+func TestDifferenceIterator(t *testing.T) {
+	a := NewTrie()
+	insert(t, a, []string{"a", "ab", "b"})
+
+	b := NewTrie()
+	insert(t, b, []string{"a", "ab", "abc", "b", "c"})
+
+	diff := NewDifferenceIterator(a.NodeIterator(nil), b.NodeIterator(nil))
+	var got [][]byte
+	for diff.Next() {
+		got = append(got, diff.LeafKey())
+	}
+	if diff.Err() != nil {
+		t.Fatalf("unexpected error: %v", diff.Err())
+	}
+	want := [][]byte{[]byte("abc"), []byte("c")}
+	if len(got) != len(want) {
+		t.Fatalf("difference produced %v, want %v", got, want)
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("difference produced %v, want %v", got, want)
+		}
+	}
+}
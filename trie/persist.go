@@ -0,0 +1,277 @@
+package trie
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+)
+
+// encodedChild is the on-disk representation of one entry in a node's
+// childList: just enough to keep descending (the edge label) plus a
+// pointer to the child's own serialized form (its content hash). The
+// child's term flag and value live in its own blob, not here.
+type encodedChild struct {
+	Label []rune
+	Hash  []byte
+}
+
+// encodedNode is the on-disk representation of a single Node. Size is
+// only ever populated on the root's blob; it lets NewTrieWithBackend
+// learn the trie's key count without walking the whole tree.
+type encodedNode struct {
+	Term     bool
+	Value    []byte `json:",omitempty"`
+	Children []encodedChild
+	Size     int `json:",omitempty"`
+}
+
+// NewTrieWithBackend opens a Trie whose nodes live in backend, keyed by
+// content hash, rather than entirely in memory. A zero-length rootHash
+// opens an empty trie. Otherwise the root is fetched and decoded
+// eagerly, but its descendants stay as unmaterialized stubs until a
+// Find, PrefixSearch, or Delete actually walks down to them, so a trie
+// much larger than RAM can still answer point lookups.
+//
+// Values default to being encoded with JSONValueCodec; call
+// SetValueCodec before Commit or any lookup if that doesn't suit the
+// stored values.
+func NewTrieWithBackend(backend Backend, rootHash []byte) (*Trie, error) {
+	t := &Trie{
+		backend: backend,
+		cache:   NewCache(backend),
+		codec:   JSONValueCodec{},
+	}
+	if len(rootHash) == 0 {
+		t.root = &Node{children: newChildList(), resolved: true}
+		return t, nil
+	}
+	t.root = &Node{hash: append([]byte(nil), rootHash...)}
+	if err := t.materialize(t.root); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetValueCodec overrides the ValueCodec a backend-backed Trie uses to
+// encode and decode terminal values. It has no effect on a Trie that
+// was created with NewTrie, since that one never touches a Backend.
+func (t *Trie) SetValueCodec(codec ValueCodec) {
+	t.codec = codec
+}
+
+// LastErr returns the error, if any, that the most recent Find,
+// PrefixSearch, Delete, NextKey, or ClearPrefix call stopped on while
+// lazily materializing a node from the backend. It's nil for a Trie
+// created with NewTrie, and reset to nil at the start of each of those
+// calls. ReplaceOrInsert also records a materialization failure here,
+// but does not reset it first.
+func (t *Trie) LastErr() error {
+	return t.lastErr
+}
+
+// markDirty flags n and every ancestor up to the root as needing
+// re-serialization on the next Commit, stopping as soon as it reaches
+// a node already marked (everything above it must already be marked
+// too, from some earlier mutation in the same or a prior Commit cycle).
+func markDirty(n *Node) {
+	for n != nil && !n.dirty {
+		n.dirty = true
+		n = n.parent
+	}
+}
+
+// materialize decodes node's blob from the backend the first time
+// node's children are needed, turning it from a hash-only stub into a
+// usable node with its own term flag, value, and (still-stub) children.
+// It's a no-op once node.resolved is true, and for a Trie created with
+// NewTrie (no backend) every node starts out resolved, so materialize
+// returns at once on that path.
+func (t *Trie) materialize(node *Node) error {
+	if node.resolved {
+		return nil
+	}
+	if node.hash == nil {
+		// Never committed, so it has no children yet.
+		node.children = newChildList()
+		node.resolved = true
+		return nil
+	}
+
+	blob, err := t.cache.Get(node.hash)
+	if err != nil {
+		return &MissingNodeError{Hash: append([]byte(nil), node.hash...), Path: node.Key()}
+	}
+	var enc encodedNode
+	if jerr := json.Unmarshal(blob, &enc); jerr != nil {
+		return jerr
+	}
+
+	node.term = enc.Term
+	if enc.Term {
+		v, derr := t.codec.Decode(enc.Value)
+		if derr != nil {
+			return derr
+		}
+		node.value = v
+	}
+	children := newChildList()
+	for _, ec := range enc.Children {
+		children = children.set(ec.Label[0], &Node{
+			label:  append([]rune(nil), ec.Label...),
+			parent: node,
+			depth:  node.depth + len(ec.Label),
+			hash:   append([]byte(nil), ec.Hash...),
+		})
+	}
+	node.children = children
+	node.resolved = true
+	if node == t.root {
+		t.size = enc.Size
+	}
+	return nil
+}
+
+// Commit serializes every node whose subtree has changed since the
+// last Commit (or since NewTrieWithBackend, for a freshly opened one)
+// and writes each as a blob keyed by its content hash. It returns the
+// root's hash, which is what a later NewTrieWithBackend call needs to
+// reopen this trie.
+func (t *Trie) Commit() ([]byte, error) {
+	if t.backend == nil {
+		return nil, errors.New("trie: Commit requires a Trie created with NewTrieWithBackend")
+	}
+	hash, err := t.commitNode(t.root, true)
+	if err != nil {
+		return nil, err
+	}
+	t.root.hash = hash
+	t.root.dirty = false
+	return hash, nil
+}
+
+func (t *Trie) commitNode(node *Node, isRoot bool) ([]byte, error) {
+	if !node.dirty && node.hash != nil {
+		return node.hash, nil
+	}
+	if err := t.materialize(node); err != nil {
+		return nil, err
+	}
+
+	enc := encodedNode{Term: node.term}
+	if isRoot {
+		enc.Size = t.size
+	}
+	if node.term {
+		v, err := t.codec.Encode(node.value)
+		if err != nil {
+			return nil, err
+		}
+		enc.Value = v
+	}
+
+	var childErr error
+	node.children.each(func(r rune, c *Node) bool {
+		hash, err := t.commitNode(c, false)
+		if err != nil {
+			childErr = err
+			return false
+		}
+		c.hash = hash
+		c.dirty = false
+		enc.Children = append(enc.Children, encodedChild{Label: append([]rune(nil), c.label...), Hash: hash})
+		return true
+	})
+	if childErr != nil {
+		return nil, childErr
+	}
+
+	blob, err := json.Marshal(enc)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(blob)
+	hash := sum[:]
+	if err := t.cache.Put(hash, blob); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// findBackendExact is findExactNode's backend-aware counterpart: it
+// materializes each node along the walk (including the one it lands
+// on) so the caller can trust its term flag and value.
+func (t *Trie) findBackendExact(key []rune) (*Node, error) {
+	node := t.root
+	if err := t.materialize(node); err != nil {
+		return nil, err
+	}
+	rest := key
+	for len(rest) > 0 {
+		child, ok := node.children.get(rest[0])
+		if !ok {
+			return nil, nil
+		}
+		cpl := commonPrefixLen(rest, child.label)
+		if cpl != len(child.label) {
+			return nil, nil
+		}
+		node = child
+		if err := t.materialize(node); err != nil {
+			return nil, err
+		}
+		rest = rest[cpl:]
+	}
+	return node, nil
+}
+
+// findBackendPrefix is findPrefixNode's backend-aware counterpart.
+func (t *Trie) findBackendPrefix(prefix []rune) (*Node, []rune, error) {
+	node := t.root
+	if err := t.materialize(node); err != nil {
+		return nil, nil, err
+	}
+	path := make([]rune, 0, len(prefix))
+	rest := prefix
+	for len(rest) > 0 {
+		child, ok := node.children.get(rest[0])
+		if !ok {
+			return nil, nil, nil
+		}
+		cpl := commonPrefixLen(rest, child.label)
+		switch {
+		case cpl < len(rest) && cpl < len(child.label):
+			return nil, nil, nil
+		case cpl < len(child.label):
+			return child, append(path, child.label...), nil
+		default:
+			node = child
+			if err := t.materialize(node); err != nil {
+				return nil, nil, err
+			}
+			path = append(path, child.label...)
+			rest = rest[cpl:]
+		}
+	}
+	return node, path, nil
+}
+
+// traverseBackend is preTraverse's backend-aware counterpart.
+func (t *Trie) traverseBackend(node *Node, prefix []rune, iter VisitFunc) error {
+	if err := t.materialize(node); err != nil {
+		return err
+	}
+	if node.term {
+		if !iter(parseRunesToText(prefix), node.Value()) {
+			return nil
+		}
+	}
+	var err error
+	node.children.each(func(r rune, c *Node) bool {
+		if e := t.traverseBackend(c, appendRunes(prefix, c.label), iter); e != nil {
+			err = e
+			return false
+		}
+		return true
+	})
+	return err
+}
@@ -0,0 +1,115 @@
+package trie
+
+import "bytes"
+
+// NextKey returns the smallest terminating key strictly greater than
+// key, or nil if there is none. It reuses NodeIterator's seek, which
+// already lands on the first key greater than or equal to key; NextKey
+// just has to step past key itself if it happens to be stored.
+//
+// For a Trie opened with NewTrieWithBackend, NextKey inherits
+// NodeIterator's lazy materialization; a backend miss stops the walk
+// and is reported through LastErr.
+func (t *Trie) NextKey(key []byte) []byte {
+	if t.backend != nil {
+		t.lastErr = nil
+	}
+	it := t.NodeIterator(key)
+	for it.Next() {
+		if !it.Leaf() {
+			continue
+		}
+		if k := it.LeafKey(); !bytes.Equal(k, key) {
+			return k
+		}
+	}
+	if t.backend != nil {
+		if err := it.Err(); err != nil {
+			t.lastErr = err
+		}
+	}
+	return nil
+}
+
+// ClearPrefix removes every key stored under prefix and returns how
+// many were removed, compacting empty ancestors the same way Delete
+// does.
+//
+// For a Trie opened with NewTrieWithBackend, ClearPrefix lazily
+// materializes every node it walks through, the same as Find/Delete/
+// PrefixSearch; a backend miss leaves the trie unchanged and is
+// reported through LastErr.
+func (t *Trie) ClearPrefix(prefix []byte) int {
+	prefixRune := parseTextToRunes(prefix)
+
+	var node *Node
+	if t.backend != nil {
+		t.lastErr = nil
+		n, _, err := t.findBackendPrefix(prefixRune)
+		if err != nil {
+			t.lastErr = err
+			return 0
+		}
+		node = n
+	} else {
+		node, _ = findPrefixNode(t.root, prefixRune)
+	}
+	if node == nil {
+		return 0
+	}
+
+	count, err := t.countTerms(node)
+	if err != nil {
+		t.lastErr = err
+		return 0
+	}
+	if count == 0 {
+		return 0
+	}
+
+	t.modSeq++
+	t.size -= count
+
+	if node.parent == nil {
+		// prefix matched the whole trie: reset the root in place.
+		node.children = newChildList()
+		node.term = false
+		node.value = nil
+		markDirty(node)
+		return count
+	}
+
+	parent := node.parent
+	parent.RemoveChild(node.label[0])
+	markDirty(parent)
+	compact(parent)
+	return count
+}
+
+// countTerms counts the terminal nodes in node's subtree, materializing
+// as it goes for a Trie backed by a Backend.
+func (t *Trie) countTerms(node *Node) (int, error) {
+	if t.backend != nil {
+		if err := t.materialize(node); err != nil {
+			return 0, err
+		}
+	}
+	n := 0
+	if node.term {
+		n++
+	}
+	var err error
+	node.children.each(func(r rune, c *Node) bool {
+		cn, cerr := t.countTerms(c)
+		if cerr != nil {
+			err = cerr
+			return false
+		}
+		n += cn
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package trie
+
+import "testing"
+
+func TestNextKey(t *testing.T) {
+	tree := NewTrie()
+	keys := []string{"a", "ab", "abc", "abd", "ac", "b"}
+	insert(t, tree, keys)
+
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{"a", "ab"},    // key itself is stored: still returns the next one
+		{"ab", "abc"},  // key itself is stored, with deeper keys beyond it
+		{"abc", "abd"}, // key is a stored leaf: next is its sibling
+		{"x", ""},      // sorts after every stored key
+		{"abd", "ac"},  // next-greater sibling one level up
+		{"b", ""},      // the very last key
+	}
+	for _, c := range cases {
+		got := tree.NextKey([]byte(c.key))
+		if c.want == "" {
+			if got != nil {
+				t.Fatalf("NextKey(%q) = %q, want nil", c.key, got)
+			}
+			continue
+		}
+		if string(got) != c.want {
+			t.Fatalf("NextKey(%q) = %q, want %q", c.key, got, c.want)
+		}
+	}
+}
+
+func TestNextKeyPrefixOfStoredKeys(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"application", "apple"})
+
+	// "appl" is a proper prefix of both stored keys but is not itself
+	// stored; NextKey should land on the leftmost terminal descendant.
+	got := tree.NextKey([]byte("appl"))
+	if string(got) != "apple" {
+		t.Fatalf("NextKey(%q) = %q, want %q", "appl", got, "apple")
+	}
+}
+
+func TestClearPrefix(t *testing.T) {
+	tree := NewTrie()
+	keys := []string{"a", "ab", "abc", "abd", "ac", "b", "bc"}
+	insert(t, tree, keys)
+
+	n := tree.ClearPrefix([]byte("ab"))
+	if n != 3 {
+		t.Fatalf("ClearPrefix(%q) removed %d keys, want 3", "ab", n)
+	}
+	getCheck(t, tree, []string{"a", "ac", "b", "bc"})
+	for _, key := range []string{"ab", "abc", "abd"} {
+		if _, ok := tree.Find([]byte(key)); ok {
+			t.Fatalf("expected %q to be removed", key)
+		}
+	}
+	if tree.Size() != 4 {
+		t.Fatalf("Size() = %d, want 4", tree.Size())
+	}
+
+	// clearing a prefix with no matches is a no-op.
+	if n := tree.ClearPrefix([]byte("zzz")); n != 0 {
+		t.Fatalf("ClearPrefix on an absent prefix removed %d, want 0", n)
+	}
+
+	// clearing the whole trie empties it but leaves it usable.
+	n = tree.ClearPrefix(nil)
+	if n != 4 {
+		t.Fatalf("ClearPrefix(nil) removed %d keys, want 4", n)
+	}
+	if tree.Size() != 0 {
+		t.Fatalf("Size() = %d after clearing everything, want 0", tree.Size())
+	}
+	tree.ReplaceOrInsert([]byte("fresh"), "fresh")
+	getCheck(t, tree, []string{"fresh"})
+}
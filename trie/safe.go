@@ -0,0 +1,41 @@
+package trie
+
+import "sync"
+
+// SafeTrie guards a Trie with a sync.RWMutex, for the common case of
+// this trie being used as a concurrently-accessed ID index (short,
+// human-typed keys resolved to full ones via Get) where reads and
+// writes can come from different goroutines.
+type SafeTrie struct {
+	mu   sync.RWMutex
+	trie *Trie
+}
+
+// NewSafeTrie returns a SafeTrie wrapping a freshly created Trie.
+func NewSafeTrie() *SafeTrie {
+	return &SafeTrie{trie: NewTrie()}
+}
+
+func (s *SafeTrie) ReplaceOrInsert(key []byte, value interface{}) *Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trie.ReplaceOrInsert(key, value)
+}
+
+func (s *SafeTrie) Delete(key []byte) *Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trie.Delete(key)
+}
+
+func (s *SafeTrie) Get(prefix []byte) (*Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Get(prefix)
+}
+
+func (s *SafeTrie) Find(key []byte) (*Node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Find(key)
+}
@@ -1,27 +1,51 @@
 // Implementation of an R-Way Trie data structure.
 //
 // A Trie has a root Node which is the base of the tree.
+//
+// Internally each Node stores an edge label (a slice of runes) rather
+// than a single code point, so a chain of single-child nodes collapses
+// into one node with a multi-character prefix. This is the classic
+// Patricia/radix compression: it cuts memory use and the number of
+// pointer hops a lookup needs on key sets with long shared prefixes
+// (URL paths, container IDs, and the like).
 package trie
 
 import (
-	"sort"
 	"unicode/utf8"
 )
 
-type NodeIterator func(key []byte, val interface{}) bool
+// VisitFunc is the callback PrefixSearch (and Keys) drives: it's called
+// with each stored key and value in lexicographic order, and returning
+// false skips the rest of that key's subtree.
+type VisitFunc func(key []byte, val interface{}) bool
 
 type Node struct {
-	code     rune         // code of node
-	term     bool         // last node flag
-	depth    int
-	value interface{}  // property of node
+	label    []rune      // edge label leading from the parent to this node
+	term     bool        // last node flag
+	depth    int         // number of runes from root to this node
+	value    interface{} // property of node
 	parent   *Node
-	children map[rune]*Node
+	children childList // keyed by the first rune of each child's label
+
+	// The fields below only matter for a Trie opened with
+	// NewTrieWithBackend; a Trie created with NewTrie marks every node
+	// resolved, and never reads hash or dirty.
+	hash     []byte // content hash of this node's last-Commit'd blob; nil if never committed
+	resolved bool    // whether children has been materialized from the backend
+	dirty    bool    // whether this node's subtree has changed since its hash was computed
 }
 
 type Trie struct {
-	root *Node
-	size int
+	root   *Node
+	size   int
+	modSeq int // bumped on every structural mutation, for NodeIterator's concurrent-modification check
+
+	// backend, cache, and codec are only set for a Trie opened with
+	// NewTrieWithBackend; see persist.go.
+	backend Backend
+	cache   *Cache
+	codec   ValueCodec
+	lastErr error // the error, if any, the last lookup or mutation hit while materializing; see LastErr
 }
 
 type ByRune []rune
@@ -32,7 +56,7 @@ func (a ByRune) Less(i, j int) bool { return a[i] < a[j] }
 // Creates a new Trie with an initialized root Node.
 func NewTrie() *Trie {
 	return &Trie{
-		root: &Node{children: make(map[rune]*Node), depth: 0},
+		root: &Node{children: newChildList(), depth: 0, resolved: true},
 		size: 0,
 	}
 }
@@ -46,113 +70,231 @@ func (t *Trie) Size() int {
 	return t.size
 }
 
-// ReplaceOrInsert adds the given key to the tree.  If an key in the tree
-// already equals the given one, it is removed from the tree and returned.
-// Otherwise, nil is returned.
+// ReplaceOrInsert adds the given key to the tree. If a key in the tree
+// already equals the given one, its previous value is captured in the
+// returned Node. Otherwise, nil is returned.
+//
+// Edges are split as needed so every node keeps a single contiguous
+// label: inserting a key that diverges partway through an existing
+// edge breaks that edge at the divergence point and hangs the two
+// halves off a new branch node.
 func (t *Trie) ReplaceOrInsert(key []byte, value interface{}) *Node {
-	if len(key) == 0 {
+	keyRune := parseTextToRunes(key)
+	if len(keyRune) == 0 {
 		return nil
 	}
-	node := t.root
-	var pre *Node
-	offset := 0
-	for len(key[offset:]) > 0 {
-		e, size := utf8.DecodeRune(key[offset:])
-		if e == utf8.RuneError {
+	t.modSeq++
+	return t.insert(t.root, keyRune, value)
+}
+
+func (t *Trie) insert(node *Node, rest []rune, value interface{}) *Node {
+	// For a Trie opened with NewTrieWithBackend, each node along the
+	// insert path is materialized here before its children are read,
+	// so no prior Find is needed to load the path.
+	if t.backend != nil {
+		if err := t.materialize(node); err != nil {
+			t.lastErr = err
 			return nil
 		}
-		offset += size
-		if n, ok := node.children[e]; ok {
-			node = n
-			pre = n
-		} else {
-			node = node.NewChildNode(e, nil, false)
-			pre = nil
-		}
 	}
 
-	// new node
-	if pre == nil {
-		node.value = value
-		node.term = true
+	first := rest[0]
+	child, ok := node.children.get(first)
+	if !ok {
+		n := node.NewChildNode(rest, value, true)
+		markDirty(n)
 		t.size++
-	} else {
-		node = &Node{
-			code:     pre.code,
-			term:     pre.term,
-			value:    value,
-			parent:   pre.parent,
-			children: pre.children,
-			depth:    pre.depth,
+		return nil
+	}
+
+	cpl := commonPrefixLen(rest, child.label)
+	switch {
+	case cpl == len(child.label) && cpl == len(rest):
+		// rest matches this child's whole label: replace its value.
+		// child.term/child.value may still be unresolved stub fields,
+		// so materialize before reading or overwriting them.
+		if t.backend != nil {
+			if err := t.materialize(child); err != nil {
+				t.lastErr = err
+				return nil
+			}
+		}
+		var old *Node
+		if child.term {
+			old = &Node{
+				label:  append([]rune(nil), child.label...),
+				parent: child.parent,
+				depth:  child.depth,
+				term:   true,
+				value:  child.value,
+			}
+		} else {
+			t.size++
 		}
-		node.parent.ReplaceOrInsertChildNode(node)
+		child.value = value
+		child.term = true
+		markDirty(child)
+		return old
+	case cpl == len(child.label):
+		// child's label fully consumed, keep descending with what's left.
+		return t.insert(child, rest[cpl:], value)
+	case cpl == len(rest):
+		// rest ends partway through child's label: split the edge and
+		// make the split point the new terminal node.
+		mid := node.splitChild(child, cpl)
+		mid.value = value
+		mid.term = true
+		markDirty(mid)
+		t.size++
+		return nil
+	default:
+		// rest diverges from child's label partway through: split the
+		// edge and hang a fresh leaf for the remainder of rest.
+		mid := node.splitChild(child, cpl)
+		n := mid.NewChildNode(rest[cpl:], value, true)
+		markDirty(n)
+		t.size++
+		return nil
 	}
-	return pre
+}
+
+// splitChild breaks child's label at cpl runes, inserting a new
+// non-terminal node in its place that holds the shared prefix, with
+// child (now holding the remaining suffix) hanging off it.
+func (n *Node) splitChild(child *Node, cpl int) *Node {
+	mid := &Node{
+		label:    append([]rune(nil), child.label[:cpl]...),
+		parent:   n,
+		depth:    n.depth + cpl,
+		children: newChildList(),
+		resolved: true,
+	}
+	n.ReplaceOrInsertChildNode(mid)
+
+	child.label = append([]rune(nil), child.label[cpl:]...)
+	child.parent = mid
+	child.depth = mid.depth + len(child.label)
+	mid.ReplaceOrInsertChildNode(child)
+	return mid
 }
 
 // Finds and returns property data associated
 // with `key`.
+//
+// For a Trie opened with NewTrieWithBackend, Find lazily materializes
+// every node it walks through; if the backend can't supply one, Find
+// returns (nil, false) and the MissingNodeError is available from
+// LastErr.
 func (t *Trie) Find(key []byte) (*Node, bool) {
 	keyRune := parseTextToRunes(key)
-	node := findNode(t.Root(), keyRune)
-	if node == nil {
-		return nil, false
+
+	var node *Node
+	if t.backend != nil {
+		t.lastErr = nil
+		n, err := t.findBackendExact(keyRune)
+		if err != nil {
+			t.lastErr = err
+			return nil, false
+		}
+		node = n
+	} else {
+		node = findExactNode(t.Root(), keyRune)
 	}
-	if !node.term {
+	if node == nil || !node.term {
 		return nil, false
 	}
 
 	return &Node{
-		code:     node.code,
-		parent:   node.Parent(),
-		depth:    node.Depth(),
-		term:     node.Terminating(),
-		value:    node.value,
+		label:  append([]rune(nil), node.label...),
+		parent: node.Parent(),
+		depth:  node.Depth(),
+		term:   node.Terminating(),
+		value:  node.value,
 	}, true
 }
 
 func (t *Trie) HasKeysWithPrefix(key []byte) bool {
 	keyRune := parseTextToRunes(key)
-	node := findNode(t.Root(), keyRune)
+	node, _ := findPrefixNode(t.Root(), keyRune)
 	return node != nil
 }
 
 // Removes a key from the trie.
 // Return delete node if exist
 // Note make sure the key is not only a prefix
+//
+// For a Trie opened with NewTrieWithBackend, Delete lazily
+// materializes every node it walks through, the same as Find; a
+// backend miss leaves the trie unchanged and is reported through
+// LastErr.
 func (t *Trie) Delete(key []byte) *Node {
 	keyRune := parseTextToRunes(key)
-	node := findNode(t.Root(), keyRune)
-	var del *Node
-	if node.term {
-		t.size--
-		del = node
-		if len(node.children) > 0 {
-			// we just flag the term
-			node.term = false
-		} else {
-			// no children node, we need delete from parent node
-			if node.Parent() != nil {
-				node.parent.RemoveChild(node.code)
-				// check the parent if the node has no children nodes
-				for n := node.Parent(); n != nil; n = n.Parent() {
-					if n.term {
-						break
-					}
-					if len(n.children) > 0 {
-						break
-					}
-					if n.Parent() != nil {
-						n.parent.RemoveChild(n.code)
-					}
-				}
-			}
+
+	var node *Node
+	if t.backend != nil {
+		t.lastErr = nil
+		n, err := t.findBackendExact(keyRune)
+		if err != nil {
+			t.lastErr = err
+			return nil
 		}
-		return del
+		node = n
 	} else {
-		// not end node
+		node = findExactNode(t.Root(), keyRune)
+	}
+	if node == nil || !node.term {
 		return nil
 	}
+
+	del := &Node{
+		label:  append([]rune(nil), node.label...),
+		parent: node.parent,
+		depth:  node.depth,
+		term:   true,
+		value:  node.value,
+	}
+	t.modSeq++
+	t.size--
+	node.term = false
+	node.value = nil
+	markDirty(node)
+	compact(node)
+	return del
+}
+
+// compact walks up from n, pruning nodes left with no value and no
+// children, and merging a node left with no value and a single child
+// into that child (folding the two edge labels into one). It stops as
+// soon as it reaches a node that still earns its place in the tree.
+func compact(n *Node) {
+	for n != nil {
+		parent := n.parent
+		if parent == nil {
+			return
+		}
+		switch {
+		case n.term:
+			return
+		case n.children.len() == 0:
+			parent.RemoveChild(n.label[0])
+			markDirty(parent)
+			n = parent
+		case n.children.len() == 1:
+			var only *Node
+			n.children.each(func(r rune, c *Node) bool {
+				only = c
+				return false
+			})
+			only.label = append(append([]rune(nil), n.label...), only.label...)
+			only.parent = parent
+			only.depth = parent.depth + len(only.label)
+			parent.ReplaceOrInsertChildNode(only)
+			markDirty(parent)
+			return
+		default:
+			return
+		}
+	}
 }
 
 // Returns all the keys currently stored in the trie.
@@ -170,36 +312,59 @@ func (t *Trie) Keys() [][]byte {
 
 // Performs a prefix search against the keys in the trie.
 // The key and value are only valid for the life of the iterator.
-func (t *Trie) PrefixSearch(pre []byte, iter NodeIterator) {
+//
+// For a Trie opened with NewTrieWithBackend, PrefixSearch lazily
+// materializes every node it walks through; a backend miss stops the
+// search early and is reported through LastErr.
+func (t *Trie) PrefixSearch(pre []byte, iter VisitFunc) {
 	preRune := parseTextToRunes(pre)
-	node := findNode(t.Root(), preRune)
+
+	if t.backend != nil {
+		t.lastErr = nil
+		node, path, err := t.findBackendPrefix(preRune)
+		if err != nil {
+			t.lastErr = err
+			return
+		}
+		if node == nil {
+			return
+		}
+		if err := t.traverseBackend(node, path, iter); err != nil {
+			t.lastErr = err
+		}
+		return
+	}
+
+	node, path := findPrefixNode(t.Root(), preRune)
 	if node == nil {
 		return
 	}
 
-	preTraverse(node, preRune, iter)
+	preTraverse(node, path, iter)
 }
 
-// Creates and returns a pointer to a new child for the node.
-func (n *Node) NewChildNode(code rune, value interface{}, term bool) *Node {
+// Creates and returns a pointer to a new child for the node, hanging
+// off the edge labeled by the given runes.
+func (n *Node) NewChildNode(label []rune, value interface{}, term bool) *Node {
 	node := &Node{
-		code:     code,
+		label:    append([]rune(nil), label...),
 		term:     term,
 		value:    value,
 		parent:   n,
-		children: make(map[rune]*Node),
-		depth:    n.depth + 1,
+		children: newChildList(),
+		depth:    n.depth + len(label),
+		resolved: true,
 	}
-	n.children[code] = node
+	n.children = n.children.set(label[0], node)
 	return node
 }
 
 func (n *Node) ReplaceOrInsertChildNode(node *Node) {
-	n.children[node.Code()] = node
+	n.children = n.children.set(node.label[0], node)
 }
 
 func (n *Node) RemoveChild(r rune) {
-	delete(n.children, r)
+	n.children = n.children.remove(r)
 }
 
 // Returns the parent of this node.
@@ -207,9 +372,28 @@ func (n Node) Parent() *Node {
 	return n.parent
 }
 
-// Returns the children of this node.
+// Returns the children of this node. This builds a fresh map from the
+// underlying childList on every call, so prefer ForEachChild in code
+// that walks children often.
 func (n Node) Children() map[rune]*Node {
-	return n.children
+	m := make(map[rune]*Node)
+	if n.children == nil {
+		return m
+	}
+	n.children.each(func(r rune, c *Node) bool {
+		m[r] = c
+		return true
+	})
+	return m
+}
+
+// ForEachChild calls fn for every child of this node in ascending rune
+// order, stopping early if fn returns false.
+func (n Node) ForEachChild(fn func(r rune, c *Node) bool) {
+	if n.children == nil {
+		return
+	}
+	n.children.each(fn)
 }
 
 func (n Node) Terminating() bool {
@@ -220,40 +404,87 @@ func (n Node) Depth() int {
 	return n.depth
 }
 
+// Label returns the edge runes leading from this node's parent to it.
+func (n *Node) Label() []rune {
+	return n.label
+}
+
+// Code returns the first rune of this node's edge label, kept for
+// callers that only care about the branching character.
 func (n *Node) Code() rune {
-	return n.code
+	if len(n.label) == 0 {
+		return utf8.RuneError
+	}
+	return n.label[0]
 }
 
 func (n *Node) Value() interface{} {
 	return n.value
 }
 
-func findNode(node *Node, key []rune) *Node {
-	if node == nil {
-		return nil
+// findExactNode walks key from node, following edges only when they
+// match in full, and returns the node whose path equals key exactly.
+// It returns nil if key does not land on a node boundary.
+func findExactNode(node *Node, key []rune) *Node {
+	rest := key
+	for len(rest) > 0 {
+		child, ok := node.children.get(rest[0])
+		if !ok {
+			return nil
+		}
+		cpl := commonPrefixLen(rest, child.label)
+		if cpl != len(child.label) {
+			return nil
+		}
+		node = child
+		rest = rest[cpl:]
 	}
+	return node
+}
 
-	if len(key) == 0 {
-		return node
+// findPrefixNode walks prefix from node and returns the node rooting
+// the subtree of every key sharing that prefix, along with the full
+// rune path from node to the returned node. The prefix may end
+// partway through an edge label; in that case the whole edge still
+// belongs to the match.
+func findPrefixNode(node *Node, prefix []rune) (*Node, []rune) {
+	path := make([]rune, 0, len(prefix))
+	rest := prefix
+	for len(rest) > 0 {
+		child, ok := node.children.get(rest[0])
+		if !ok {
+			return nil, nil
+		}
+		cpl := commonPrefixLen(rest, child.label)
+		switch {
+		case cpl < len(rest) && cpl < len(child.label):
+			return nil, nil
+		case cpl < len(child.label):
+			return child, append(path, child.label...)
+		default:
+			node = child
+			path = append(path, child.label...)
+			rest = rest[cpl:]
+		}
 	}
+	return node, path
+}
 
-	n, ok := node.Children()[key[0]]
-	if !ok {
-		return nil
+// commonPrefixLen returns how many leading runes a and b share.
+func commonPrefixLen(a, b []rune) int {
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
 	}
-
-	var subKey []rune
-	if len(key) > 1 {
-		subKey = key[1:]
-	} else {
-		subKey = key[0:0]
+	i := 0
+	for i < max && a[i] == b[i] {
+		i++
 	}
-
-	return findNode(n, subKey)
+	return i
 }
 
 // Preorder traverse trie
-func preTraverse(node *Node, prefix []rune, iter NodeIterator) {
+func preTraverse(node *Node, prefix []rune, iter VisitFunc) {
 	if node == nil {
 		return
 	}
@@ -262,20 +493,10 @@ func preTraverse(node *Node, prefix []rune, iter NodeIterator) {
 			return
 		}
 	}
-	if len(node.Children()) == 0 {
-		return
-	}
-	// sort key
-	bs := make([]rune, 0, len(node.Children()))
-	for val, _ := range node.children {
-		bs = append(bs, val)
-	}
-	sort.Sort(ByRune(bs))
-	for _, c := range bs {
-		if n, ok := node.children[c]; ok {
-			preTraverse(n, append(prefix, n.code), iter)
-		}
-	}
+	node.children.each(func(r rune, n *Node) bool {
+		preTraverse(n, append(append([]rune(nil), prefix...), n.label...), iter)
+		return true
+	})
 }
 
 func parseTextToRunes(str []byte) []rune {
@@ -309,4 +530,3 @@ func parseRunesToText(runes []rune) []byte {
 	}
 	return _key
 }
-
@@ -3,6 +3,7 @@ package trie
 import (
 	"testing"
 	"reflect"
+	"unicode/utf8"
 )
 
 func checkNode(t *testing.T, n *Node, ex string) {
@@ -129,6 +130,69 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+// TestEdgeSplit exercises inserting a key that diverges partway through
+// an existing compressed edge and branches off into a sibling, then a
+// key that ends exactly at the resulting split point.
+func TestEdgeSplit(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"application", "apple"})
+	getCheck(t, tree, []string{"application", "apple"})
+
+	// "appl" sits at the split point shared by both keys and should now
+	// become its own terminal node without disturbing the others.
+	insert(t, tree, []string{"appl"})
+	getCheck(t, tree, []string{"appl", "apple", "application"})
+
+	_, find := tree.Find([]byte("app"))
+	if find {
+		t.Fatal("unexpected match for non-stored prefix")
+	}
+}
+
+// TestEdgeMerge checks that deleting a branch node collapses back down
+// to a single compressed edge once only one child remains.
+func TestEdgeMerge(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"apple", "application"})
+
+	n := tree.Delete([]byte("apple"))
+	checkNode(t, n, "apple")
+	getCheck(t, tree, []string{"application"})
+
+	// only one key remains, so the root's single child should now carry
+	// the whole "application" label rather than a split "appl"/"ication".
+	root := tree.Root()
+	if len(root.Children()) != 1 {
+		t.Fatalf("expected a single compressed child, got %d", len(root.Children()))
+	}
+	for _, c := range root.Children() {
+		if string(c.Label()) != "application" {
+			t.Fatalf("expected merged label %q, got %q", "application", string(c.Label()))
+		}
+	}
+}
+
+// TestUTF8Boundary makes sure multi-byte runes are never split mid-rune
+// when edges are split or merged.
+func TestUTF8Boundary(t *testing.T) {
+	tree := NewTrie()
+	keys := []string{"日本語", "日本人", "日本"}
+	insert(t, tree, keys)
+	getCheck(t, tree, keys)
+
+	n := tree.Delete([]byte("日本"))
+	checkNode(t, n, "日本")
+	getCheck(t, tree, []string{"日本語", "日本人"})
+
+	for _, c := range tree.Root().Children() {
+		for _, r := range c.Label() {
+			if r == utf8.RuneError {
+				t.Fatalf("edge label contains a broken rune: %q", string(c.Label()))
+			}
+		}
+	}
+}
+
 func TestPrefixSearch(t *testing.T) {
 	tree := NewTrie()
 	keys := []string{"a", "ab", "abc", "abcdef", "abd", "b", "bc", "bcd", "bce"}
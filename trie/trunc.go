@@ -0,0 +1,124 @@
+package trie
+
+import "errors"
+
+var (
+	// ErrEmptyPrefix is returned by Get when called with an empty prefix.
+	ErrEmptyPrefix = errors.New("trie: prefix is empty")
+	// ErrNotFound is returned by Get when no stored key has the given prefix.
+	ErrNotFound = errors.New("trie: prefix not found")
+	// ErrAmbiguousPrefix is returned by Get when more than one stored key
+	// shares the given prefix.
+	ErrAmbiguousPrefix = errors.New("trie: prefix matches more than one key")
+)
+
+// Get resolves prefix to the single stored key it identifies, the way
+// Docker's pkg/truncindex resolves a short, human-typed ID to the one
+// full ID it's short for. It fails with ErrAmbiguousPrefix rather than
+// guessing if two or more stored keys share the prefix.
+//
+// For a Trie opened with NewTrieWithBackend, Get lazily materializes
+// every node it walks through, the same as Find/Delete/PrefixSearch; a
+// backend miss comes back as a *MissingNodeError.
+func (t *Trie) Get(prefix []byte) (*Node, error) {
+	if len(prefix) == 0 {
+		return nil, ErrEmptyPrefix
+	}
+
+	var node *Node
+	if t.backend != nil {
+		n, _, err := t.findBackendPrefix(parseTextToRunes(prefix))
+		if err != nil {
+			return nil, err
+		}
+		node = n
+	} else {
+		node, _ = findPrefixNode(t.root, parseTextToRunes(prefix))
+	}
+	if node == nil {
+		return nil, ErrNotFound
+	}
+
+	match, ambiguous, err := t.firstTwoTerms(node)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		return nil, ErrNotFound
+	}
+	if ambiguous {
+		return nil, ErrAmbiguousPrefix
+	}
+
+	return &Node{
+		label:  append([]rune(nil), match.label...),
+		parent: match.parent,
+		depth:  match.depth,
+		term:   true,
+		value:  match.value,
+	}, nil
+}
+
+// firstTwoTerms reports the first terminal node found in node's
+// subtree (preorder), and whether a second one exists, materializing
+// as it goes for a Trie backed by a Backend.
+func (t *Trie) firstTwoTerms(node *Node) (match *Node, ambiguous bool, err error) {
+	if t.backend != nil {
+		if err := t.materialize(node); err != nil {
+			return nil, false, err
+		}
+	}
+	node.children.each(func(r rune, c *Node) bool {
+		if match != nil {
+			ambiguous = true
+			return false
+		}
+		cm, camb, cerr := t.firstTwoTerms(c)
+		if cerr != nil {
+			err = cerr
+			return false
+		}
+		if cm != nil {
+			if match == nil {
+				match = cm
+			} else {
+				ambiguous = true
+			}
+		}
+		if camb {
+			ambiguous = true
+		}
+		return !ambiguous
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if node.term {
+		if match != nil {
+			ambiguous = true
+		}
+		match = node
+	}
+	return match, ambiguous, nil
+}
+
+// Iterate walks every key stored under prefix, calling iter for each
+// in lexicographic order. Unlike Get, it doesn't require the prefix to
+// resolve uniquely.
+func (t *Trie) Iterate(prefix []byte, iter VisitFunc) {
+	t.PrefixSearch(prefix, iter)
+}
+
+// Key reconstructs the full key from the trie's root down to this
+// node by walking parent edge labels back up the tree.
+func (n *Node) Key() []byte {
+	var labels [][]rune
+	for cur := n; cur != nil && cur.parent != nil; cur = cur.parent {
+		labels = append(labels, cur.label)
+	}
+	var path []rune
+	for i := len(labels) - 1; i >= 0; i-- {
+		path = append(path, labels[i]...)
+	}
+	return parseRunesToText(path)
+}
@@ -0,0 +1,83 @@
+package trie
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGetUniquePrefix(t *testing.T) {
+	tree := NewTrie()
+	ids := []string{"c3f279d17e0a", "c3f279d17e0b", "a4d8f3"}
+	insert(t, tree, ids)
+
+	n, err := tree.Get([]byte("a4"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(n.Key()) != "a4d8f3" {
+		t.Fatalf("Get(%q).Key() = %q, want %q", "a4", n.Key(), "a4d8f3")
+	}
+}
+
+func TestGetAmbiguousPrefix(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"c3f279d17e0a", "c3f279d17e0b"})
+
+	_, err := tree.Get([]byte("c3f279"))
+	if err != ErrAmbiguousPrefix {
+		t.Fatalf("Get on an ambiguous prefix returned %v, want ErrAmbiguousPrefix", err)
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"a4d8f3"})
+
+	if _, err := tree.Get([]byte("zz")); err != ErrNotFound {
+		t.Fatalf("Get on a missing prefix returned %v, want ErrNotFound", err)
+	}
+	if _, err := tree.Get(nil); err != ErrEmptyPrefix {
+		t.Fatalf("Get on an empty prefix returned %v, want ErrEmptyPrefix", err)
+	}
+}
+
+func TestIterateRestrictsToPrefix(t *testing.T) {
+	tree := NewTrie()
+	insert(t, tree, []string{"a4d8f3", "a4d8ff", "b1"})
+
+	var got []string
+	tree.Iterate([]byte("a4d8"), func(key []byte, val interface{}) bool {
+		got = append(got, string(key))
+		return true
+	})
+	want := []string{"a4d8f3", "a4d8ff"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Iterate(%q) = %v, want %v", "a4d8", got, want)
+	}
+}
+
+func TestSafeTrieConcurrentAccess(t *testing.T) {
+	st := NewSafeTrie()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			st.ReplaceOrInsert([]byte{byte('a' + i%26), byte(i)}, i)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			st.Find([]byte{byte('a' + i%26), byte(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	n, err := st.Get([]byte{'a', 0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n.Value().(int) != 0 {
+		t.Fatalf("Get returned value %v, want 0", n.Value())
+	}
+}